@@ -0,0 +1,289 @@
+// Package cors implements a configurable Cross-Origin Resource Sharing
+// middleware, modeled on the semantics of rs/cors. It replaces the
+// "allow any origin" stub that used to live in the gateway's main package.
+package cors
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Options configures the behavior of a Cors instance. The zero value
+// denies all cross-origin requests - callers must opt in to the origins,
+// methods, and headers they want to allow.
+type Options struct {
+	// AllowedOrigins is the list of origins a cross-domain request can be
+	// made from. An origin may be a literal ("https://example.com") or
+	// contain a single "*" wildcard ("https://*.example.com"). Use "*" to
+	// allow any origin, but this is rejected when AllowCredentials is true
+	// to avoid the well-known reflection vulnerability.
+	AllowedOrigins []string
+
+	// AllowedOriginPatterns is an additional list of regexps matched
+	// against the request's Origin header. It is checked after
+	// AllowedOrigins.
+	AllowedOriginPatterns []*regexp.Regexp
+
+	// AllowedMethods is the list of methods allowed for cross-origin
+	// requests. There is no default: with an empty list, only preflights
+	// for OPTIONS itself pass.
+	AllowedMethods []string
+
+	// AllowedHeaders is the list of non-simple headers the client is
+	// allowed to send. A "*" entry allows any header.
+	AllowedHeaders []string
+
+	// ExposedHeaders indicates which headers are safe to expose to the
+	// CORS API specification via the Access-Control-Expose-Headers header.
+	ExposedHeaders []string
+
+	// AllowCredentials indicates whether the request can include user
+	// credentials like cookies, HTTP authentication, or client side SSL
+	// certificates.
+	AllowCredentials bool
+
+	// MaxAge indicates how long, in seconds, the results of a preflight
+	// request can be cached. A value of 0 omits the header.
+	MaxAge int
+
+	// OptionsPassthrough instructs the middleware to let the next handler
+	// process OPTIONS requests instead of short-circuiting them. This is
+	// useful when a router already handles OPTIONS itself.
+	OptionsPassthrough bool
+
+	// Debug enables verbose logging of CORS decisions via log.Printf.
+	Debug bool
+}
+
+// Cors implements http.Handler middleware that enforces an Options policy.
+type Cors struct {
+	opts Options
+
+	allowAnyOrigin  bool
+	allowedOrigins  []wildcard
+	allowedPatterns []*regexp.Regexp
+	allowedMethods  map[string]bool
+	allowedHeaders  map[string]bool
+	allowAnyHeader  bool
+	exposedHeaders  string
+	maxAge          string
+}
+
+// New builds a Cors middleware from opts.
+func New(opts Options) *Cors {
+	c := &Cors{
+		opts:            opts,
+		allowedMethods:  make(map[string]bool, len(opts.AllowedMethods)),
+		allowedHeaders:  make(map[string]bool, len(opts.AllowedHeaders)),
+		allowedPatterns: opts.AllowedOriginPatterns,
+	}
+
+	for _, origin := range opts.AllowedOrigins {
+		if origin == "*" {
+			c.allowAnyOrigin = true
+			continue
+		}
+		c.allowedOrigins = append(c.allowedOrigins, newWildcard(origin))
+	}
+	if c.allowAnyOrigin && opts.AllowCredentials {
+		// Reflecting "*" while sending credentials would let any site
+		// read the response - never allow this combination.
+		c.allowAnyOrigin = false
+	}
+
+	for _, method := range opts.AllowedMethods {
+		c.allowedMethods[strings.ToUpper(method)] = true
+	}
+
+	for _, header := range opts.AllowedHeaders {
+		if header == "*" {
+			c.allowAnyHeader = true
+			continue
+		}
+		c.allowedHeaders[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if len(opts.ExposedHeaders) > 0 {
+		c.exposedHeaders = strings.Join(opts.ExposedHeaders, ", ")
+	}
+	if opts.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(opts.MaxAge)
+	}
+
+	return c
+}
+
+// Handler wraps h with the CORS policy described by c's Options.
+func (c *Cors) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.handlePreflight(w, r)
+			if c.opts.OptionsPassthrough {
+				h.ServeHTTP(w, r)
+			} else {
+				w.WriteHeader(http.StatusOK)
+			}
+			return
+		}
+		c.handleActualRequest(w, r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handlePreflight answers an OPTIONS preflight request.
+func (c *Cors) handlePreflight(w http.ResponseWriter, r *http.Request) {
+	headers := w.Header()
+	headers.Add("Vary", "Origin")
+	headers.Add("Vary", "Access-Control-Request-Method")
+	headers.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		c.logf("preflight aborted: empty origin")
+		return
+	}
+	if !c.isOriginAllowed(origin) {
+		c.logf("preflight aborted: origin %q not allowed", origin)
+		return
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	if !c.isMethodAllowed(method) {
+		c.logf("preflight aborted: method %q not allowed", method)
+		return
+	}
+
+	reqHeaders := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	if !c.isHeaderListAllowed(reqHeaders) {
+		c.logf("preflight aborted: headers %q not allowed", reqHeaders)
+		return
+	}
+
+	c.setAllowOrigin(headers, origin)
+	headers.Set("Access-Control-Allow-Methods", strings.ToUpper(method))
+	if len(reqHeaders) > 0 {
+		headers.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if c.maxAge != "" {
+		headers.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	if c.opts.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handleActualRequest annotates a non-preflight request's response with
+// the CORS headers required for the browser to expose it to the page.
+func (c *Cors) handleActualRequest(w http.ResponseWriter, r *http.Request) {
+	headers := w.Header()
+	headers.Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || !c.isOriginAllowed(origin) {
+		return
+	}
+
+	c.setAllowOrigin(headers, origin)
+	if c.exposedHeaders != "" {
+		headers.Set("Access-Control-Expose-Headers", c.exposedHeaders)
+	}
+	if c.opts.AllowCredentials {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// setAllowOrigin echoes origin back rather than reflecting "*" whenever
+// credentials are in play, per the Fetch spec.
+func (c *Cors) setAllowOrigin(headers http.Header, origin string) {
+	if c.allowAnyOrigin && !c.opts.AllowCredentials {
+		headers.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	headers.Set("Access-Control-Allow-Origin", origin)
+}
+
+func (c *Cors) isOriginAllowed(origin string) bool {
+	if c.allowAnyOrigin {
+		return true
+	}
+	for _, w := range c.allowedOrigins {
+		if w.match(origin) {
+			return true
+		}
+	}
+	for _, pattern := range c.allowedPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cors) isMethodAllowed(method string) bool {
+	if method == "" {
+		return false
+	}
+	if method == http.MethodOptions {
+		return true
+	}
+	return c.allowedMethods[strings.ToUpper(method)]
+}
+
+func (c *Cors) isHeaderListAllowed(headers []string) bool {
+	if c.allowAnyHeader {
+		return true
+	}
+	for _, header := range headers {
+		if !c.allowedHeaders[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cors) logf(format string, args ...interface{}) {
+	if c.opts.Debug {
+		log.Printf("cors: "+format, args...)
+	}
+}
+
+func parseHeaderList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	parts := strings.Split(value, ",")
+	headers := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			headers = append(headers, part)
+		}
+	}
+	return headers
+}
+
+// wildcard matches origins containing a single "*", e.g. "https://*.example.com".
+type wildcard struct {
+	prefix string
+	suffix string
+	exact  bool
+}
+
+func newWildcard(pattern string) wildcard {
+	if i := strings.IndexByte(pattern, '*'); i >= 0 {
+		return wildcard{prefix: pattern[:i], suffix: pattern[i+1:]}
+	}
+	return wildcard{prefix: pattern, exact: true}
+}
+
+func (w wildcard) match(origin string) bool {
+	if w.exact {
+		return origin == w.prefix
+	}
+	return len(origin) >= len(w.prefix)+len(w.suffix) &&
+		strings.HasPrefix(origin, w.prefix) &&
+		strings.HasSuffix(origin, w.suffix)
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"log"
 	"net/http"
-	"strings"
 
 	"github.com/grpc-ecosystem/grpc-gateway/runtime"
 	_ "github.com/joho/godotenv/autoload"
@@ -11,67 +10,59 @@ import (
 	"google.golang.org/grpc"
 
 	things "github.com/aodin/grpc/go"
+	"github.com/aodin/grpcweb/cors"
+	"github.com/aodin/grpcweb/grpcweb"
+	"github.com/aodin/grpcweb/middleware"
+	"github.com/aodin/grpcweb/wsproxy"
 )
 
 var bindAddress = ":8080"
 
-// newGateway returns a new gateway server which translates HTTP into gRPC.
+// backendAddress is the native gRPC endpoint the gateway dials, both for
+// grpc-gateway's own JSON translation and for the gRPC-Web bridge.
+var backendAddress = ":10808"
+
+// newGateway returns a new gateway server which translates HTTP into gRPC,
+// serving REST-JSON from the grpc-gateway mux and dispatching gRPC-Web
+// requests to a grpcweb.Handler dialed against the same backend.
 func newGateway(ctx context.Context, opts ...runtime.ServeMuxOption) (http.Handler, error) {
 	log.Printf("starting gateway server on %s\n", bindAddress)
-	mux := runtime.NewServeMux(opts...)
 	dialOpts := []grpc.DialOption{grpc.WithInsecure()}
 
-	if err := things.RegisterThingsHandlerFromEndpoint(ctx, mux, ":10808", dialOpts); err != nil {
+	opts = append(opts, middleware.WithRequestIDMetadata)
+	mux := runtime.NewServeMux(opts...)
+	if err := things.RegisterThingsHandlerFromEndpoint(ctx, mux, backendAddress, dialOpts); err != nil {
 		return nil, err
 	}
-	return mux, nil
-}
 
-// handleCORS allows Cross Origin Resoruce Sharing from any origin.
-// Don't do this without consideration in production systems.
-func handleCORS(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if origin := r.Header.Get("Origin"); origin != "" {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
-				preflightHandler(w, r)
-				return
-			}
+	conn, err := grpc.DialContext(ctx, backendAddress, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	web := grpcweb.New(conn)
+
+	dispatch := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if grpcweb.IsGRPCWebRequest(r) {
+			web.ServeHTTP(w, r)
+			return
 		}
-		h.ServeHTTP(w, r)
+		mux.ServeHTTP(w, r)
 	})
-}
-
-// loggingResponseWriter records the status code of the response
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
 
-func NewLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
-	return &loggingResponseWriter{w, http.StatusOK}
+	// Bridge the things service's server-streaming RPCs to browser
+	// WebSocket clients that can't consume a chunked HTTP/1.1 response.
+	return wsproxy.New(dispatch, wsproxy.WithPathPrefix("/v1/things")), nil
 }
 
-func (lrw *loggingResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
-	lrw.ResponseWriter.WriteHeader(code)
-}
-
-// redirectHTTP will redirect any requests with a value of 'http' in the
-// header 'X-Forwarded-Proto' to HTTPS
-func redirectHTTP(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("X-Forwarded-Proto") == "http" {
-			// Use RequestURI since it is what the client set, unmodified
-			// Other methods, such as URL.String(), reassemble the URL
-			redirectTo := "https://" + r.Host + r.RequestURI
-			http.Redirect(w, r, redirectTo, http.StatusMovedPermanently)
-			return
-		}
-		// Continue the request as usual if there is any other value or no
-		// value at all
-		h.ServeHTTP(w, r)
-	})
+// defaultCORSOptions is the policy used when Run is not given one
+// explicitly. It allows the headers and methods grpc-gateway itself
+// exposes but, unlike the old handleCORS stub, requires an explicit
+// origin allowlist before it will echo back Access-Control-Allow-Origin.
+var defaultCORSOptions = cors.Options{
+	AllowedMethods: methods,
+	AllowedHeaders: headers,
+	ExposedHeaders: []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"},
+	MaxAge:         3600,
 }
 
 // headers is allowed CORS headers
@@ -98,17 +89,11 @@ var methods = []string{
 	http.MethodDelete,
 }
 
-// preflightHandler sets headers values for CORS and then short-circuits
-// the request
-func preflightHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ","))
-	w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ","))
-	w.Header().Set("Access-Control-Max-Age", "3600") // One hour
-	return
-}
-
-// Run starts a HTTP server and blocks forever if successful.
-func Run(address string, opts ...runtime.ServeMuxOption) error {
+// Run starts a cmux-multiplexed server on address and blocks until it
+// fails. corsOpts configures the allowed
+// origins; pass defaultCORSOptions to keep the previous set of headers
+// and methods while still requiring an explicit allowlist.
+func Run(address string, corsOpts cors.Options, opts ...runtime.ServeMuxOption) error {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -119,15 +104,25 @@ func Run(address string, opts ...runtime.ServeMuxOption) error {
 		return err
 	}
 	mux.Handle("/", gw)
-	return http.ListenAndServe(
-		address,
-		handleCORS(mux),
+
+	chain := middleware.Chain(
+		middleware.RequestID,
+		middleware.AccessLog,
+		middleware.Recover,
+		middleware.RedirectHTTP,
+		cors.New(corsOpts).Handler,
 	)
+
+	server := &Server{
+		GatewayMux: chain(mux),
+		Addr:       address,
+	}
+	return server.Serve(ctx)
 }
 
 func main() {
 	log.SetFlags(0) // Remove timestamp - it will be set by log ingestion
-	if err := Run(bindAddress); err != nil {
+	if err := Run(bindAddress, defaultCORSOptions); err != nil {
 		log.Fatal(err)
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/soheilhy/cmux"
+	context "golang.org/x/net/context"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// Server multiplexes native HTTP/2 gRPC traffic, gRPC-Web/REST over
+// HTTP/1.1 and HTTP/2, and (optionally) TLS over a single listening
+// socket, using cmux the same way etcd's embed layer does. This removes
+// the need for a separate ":10808" backend port in single-binary
+// deployments - GRPCServer and GatewayMux can share one Addr.
+type Server struct {
+	// GRPCServer, if set, is served natively on connections that present
+	// the HTTP/2 "content-type: application/grpc" header. If nil, all
+	// traffic is routed to GatewayMux instead.
+	GRPCServer *grpc.Server
+
+	// GatewayMux handles everything else: REST-JSON, gRPC-Web, and the
+	// WebSocket bridge, over both HTTP/1.1 and HTTP/2 (h2c when TLSConfig
+	// is nil).
+	GatewayMux http.Handler
+
+	// TLSConfig, if set, is used to wrap the listener before cmux splits
+	// it; leave nil to serve plaintext.
+	TLSConfig *tls.Config
+
+	// Addr is the address to listen on, e.g. ":8080".
+	Addr string
+}
+
+// Serve listens on s.Addr and blocks until ctx is done or a sub-server
+// fails, at which point it gracefully stops the gRPC server, shuts down
+// the HTTP server, and returns.
+func (s *Server) Serve(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	if s.TLSConfig != nil {
+		ln = tls.NewListener(ln, s.TLSConfig)
+	}
+
+	m := cmux.New(ln)
+
+	var grpcL net.Listener
+	if s.GRPCServer != nil {
+		grpcL = m.Match(cmux.HTTP2HeaderField("content-type", "application/grpc"))
+	}
+	httpL := m.Match(cmux.HTTP1Fast(), cmux.HTTP2())
+
+	httpServer := &http.Server{
+		Handler: h2c.NewHandler(s.GatewayMux, &http2.Server{}),
+	}
+
+	errs := make(chan error, 3)
+	if grpcL != nil {
+		go func() { errs <- s.GRPCServer.Serve(grpcL) }()
+	}
+	go func() { errs <- httpServer.Serve(httpL) }()
+	go func() { errs <- m.Serve() }()
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case err = <-errs:
+	}
+	if s.GRPCServer != nil {
+		s.GRPCServer.GracefulStop()
+	}
+	httpServer.Shutdown(context.Background())
+	ln.Close()
+	return err
+}
@@ -0,0 +1,234 @@
+// Package grpcweb bridges browser-originated gRPC-Web requests to a
+// standard gRPC backend. It translates the length-prefixed message
+// framing browsers send (binary or base64-encoded "-text") into
+// ordinary gRPC calls, then re-frames the response - and the trailing
+// Grpc-Status/Grpc-Message - back into the gRPC-Web format.
+//
+// Connect-Web is not supported: its content types (application/proto,
+// application/json, application/connect+proto) are never matched by
+// IsGRPCWebRequest.
+package grpcweb
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	contentTypeGRPCWeb     = "application/grpc-web"
+	contentTypeGRPCWebText = "application/grpc-web-text"
+
+	// trailerFlag marks a gRPC-Web frame as carrying trailers rather than
+	// a message, per the wire format in the grpc-web spec.
+	trailerFlag = 0x80
+)
+
+// Handler bridges gRPC-Web requests to conn, a connection to the gRPC
+// backend the gateway already dials for grpc-gateway (":10808" by
+// default). It implements http.Handler directly so it can be mounted
+// under a path prefix alongside the REST-JSON mux.
+type Handler struct {
+	conn *grpc.ClientConn
+}
+
+// New returns a Handler that proxies gRPC-Web requests onto conn.
+func New(conn *grpc.ClientConn) *Handler {
+	return &Handler{conn: conn}
+}
+
+// IsGRPCWebRequest reports whether r should be dispatched to a Handler
+// rather than the grpc-gateway JSON mux, based on its Content-Type. It
+// only recognizes gRPC-Web's own content types, not Connect-Web's.
+func IsGRPCWebRequest(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	return strings.HasPrefix(ct, contentTypeGRPCWeb)
+}
+
+// isTextRequest reports whether the request body is base64-encoded, as
+// used by browsers that cannot emit raw binary bodies (e.g. EventSource).
+func isTextRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeGRPCWebText)
+}
+
+// ServeHTTP decodes a single gRPC-Web request, invokes the equivalent
+// gRPC call against h.conn, and streams the response back framed as
+// gRPC-Web.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := strings.TrimSuffix(r.URL.Path, "/")
+	text := isTextRequest(r)
+
+	body := io.Reader(r.Body)
+	if text {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	payload, err := readFrame(body)
+	if err != nil {
+		writeStatusOnly(w, text, status.New(codes.InvalidArgument, err.Error()))
+		return
+	}
+
+	ctx := metadata.NewOutgoingContext(r.Context(), headerToMetadata(r.Header))
+
+	stream, err := h.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, method, grpc.ForceCodec(protoPassthroughCodec{}))
+	if err != nil {
+		writeStatusOnly(w, text, status.Convert(err))
+		return
+	}
+	if err := stream.SendMsg(payload); err != nil {
+		writeStatusOnly(w, text, status.Convert(err))
+		return
+	}
+	if err := stream.CloseSend(); err != nil {
+		writeStatusOnly(w, text, status.Convert(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+	flusher, _ := w.(http.Flusher)
+
+	// grpc-web-text clients base64-decode the body as one continuous
+	// stream, so the data frame(s) and the trailing status frame must
+	// share a single encoder rather than each being padded on its own.
+	out := io.Writer(w)
+	var encoder io.WriteCloser
+	if text {
+		encoder = base64.NewEncoder(base64.StdEncoding, w)
+		out = encoder
+	}
+
+	final := status.New(codes.OK, "")
+	for {
+		var msg []byte
+		err := stream.RecvMsg(&msg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			final = status.Convert(err)
+			break
+		}
+		writeFrame(out, 0, msg)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	writeStatus(out, final)
+	if encoder != nil {
+		encoder.Close()
+	}
+}
+
+// readFrame reads a single gRPC length-prefixed frame: a one byte
+// compressed flag followed by a four byte big-endian length and the
+// message bytes. Compressed frames are rejected - the browser clients
+// this bridge targets do not send them.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0]&trailerFlag != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if header[0]&0x01 != 0 {
+		return nil, errors.New("grpcweb: compressed frames are not supported")
+	}
+	length := uint32(header[1])<<24 | uint32(header[2])<<16 | uint32(header[3])<<8 | uint32(header[4])
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// writeFrame writes a single gRPC-Web frame (trailerFlag set for
+// trailers, clear for data) to w. Callers that need grpc-web-text
+// output are responsible for wrapping w in a single base64.Encoder that
+// spans the whole response, since the format base64-encodes the body as
+// one continuous stream rather than frame by frame.
+func writeFrame(w io.Writer, flag byte, payload []byte) {
+	header := make([]byte, 5)
+	header[0] = flag
+	length := uint32(len(payload))
+	header[1] = byte(length >> 24)
+	header[2] = byte(length >> 16)
+	header[3] = byte(length >> 8)
+	header[4] = byte(length)
+
+	w.Write(append(header, payload...))
+}
+
+// writeStatus writes the final trailer frame carrying Grpc-Status and
+// Grpc-Message, the only way gRPC-Web can surface an RPC's outcome since
+// browsers cannot read HTTP/2 trailers directly.
+func writeStatus(w io.Writer, st *status.Status) {
+	trailer := "grpc-status: " + strconv.Itoa(int(st.Code())) + "\r\n" +
+		"grpc-message: " + st.Message() + "\r\n"
+	writeFrame(w, trailerFlag, []byte(trailer))
+}
+
+// writeStatusOnly writes st as the entirety of the response body, for
+// the early-error paths where no data frame precedes the trailer.
+func writeStatusOnly(w http.ResponseWriter, text bool, st *status.Status) {
+	if !text {
+		writeStatus(w, st)
+		return
+	}
+	encoder := base64.NewEncoder(base64.StdEncoding, w)
+	writeStatus(encoder, st)
+	encoder.Close()
+}
+
+// forwardedHeaders lists the inbound HTTP headers headerToMetadata will
+// forward as gRPC metadata. Hop-by-hop and transport headers (Host,
+// Content-Length, Connection, ...) are never application data and must
+// not be forwarded.
+var forwardedHeaders = []string{
+	"authorization",
+	"x-request-id",
+	"x-grpc-web",
+	"x-user-agent",
+}
+
+// headerToMetadata copies the headers in forwardedHeaders from h into
+// outgoing gRPC metadata, so the backend sees the same Authorization,
+// etc. the browser sent.
+func headerToMetadata(h http.Header) metadata.MD {
+	md := make(metadata.MD, len(forwardedHeaders))
+	for _, key := range forwardedHeaders {
+		if values, ok := h[http.CanonicalHeaderKey(key)]; ok {
+			md[key] = values
+		}
+	}
+	return md
+}
+
+// protoPassthroughCodec passes already-proto-encoded []byte payloads
+// through unmodified. It lets Handler proxy arbitrary methods without
+// generating or importing their proto message types, while still
+// negotiating "proto" as the gRPC content-subtype the backend expects -
+// using any other name makes the backend reject the stream, since it
+// only has the standard proto codec registered.
+type protoPassthroughCodec struct{}
+
+func (protoPassthroughCodec) Marshal(v interface{}) ([]byte, error) {
+	return v.([]byte), nil
+}
+
+func (protoPassthroughCodec) Unmarshal(data []byte, v interface{}) error {
+	*v.(*[]byte) = data
+	return nil
+}
+
+func (protoPassthroughCodec) Name() string { return "proto" }
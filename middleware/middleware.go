@@ -0,0 +1,179 @@
+// Package middleware provides a composable chain of http.Handler
+// wrappers for the gateway: request-ID propagation, structured access
+// logging, and panic recovery. It replaces the unused
+// loggingResponseWriter that used to live alongside the gateway's Run
+// function.
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"google.golang.org/grpc/metadata"
+)
+
+// Chain composes handlers into a single func(http.Handler) http.Handler,
+// applying them in the order given: Chain(a, b)(h) serves a request as
+// a(b(h)).
+func Chain(handlers ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(handlers) - 1; i >= 0; i-- {
+			h = handlers[i](h)
+		}
+		return h
+	}
+}
+
+// requestIDKey is the context key RequestID stores the request ID under.
+type requestIDKey struct{}
+
+// RequestID honors an incoming X-Request-ID header or generates a new
+// UUID, stores it in the request context, and echoes it back on the
+// response so callers can correlate logs across the gateway and backend.
+func RequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the request ID RequestID stored on ctx,
+// or "" if none was set.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// WithRequestIDMetadata is a runtime.ServeMuxOption that propagates the
+// request ID from RequestID into outgoing gRPC metadata, so backend logs
+// can be correlated with the gateway's access log.
+var WithRequestIDMetadata = runtime.WithMetadata(
+	func(ctx context.Context, r *http.Request) metadata.MD {
+		if id := RequestIDFromContext(ctx); id != "" {
+			return metadata.Pairs("x-request-id", id)
+		}
+		return nil
+	},
+)
+
+// statusRecorder records the status code and byte count of a response so
+// AccessLog can include them after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += n
+	return n, err
+}
+
+// Flush forwards to the underlying ResponseWriter's Flusher, so the
+// gRPC-Web bridge's server-streaming responses keep flushing each chunk
+// incrementally instead of buffering until the handler returns.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack forwards to the underlying ResponseWriter's Hijacker, so the
+// WebSocket bridge can still take over the connection from behind this
+// middleware.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("middleware: underlying ResponseWriter does not support Hijack")
+	}
+	return h.Hijack()
+}
+
+// AccessLog logs each request's method, path, status, byte count,
+// duration, peer address, and request ID via slog once the handler
+// returns.
+func AccessLog(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		slog.Info("request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration", time.Since(start),
+			"peer", r.RemoteAddr,
+			"request_id", RequestIDFromContext(r.Context()),
+		)
+	})
+}
+
+// errorResponse matches the JSON shape grpc-gateway itself emits for
+// RPC errors, so a recovered panic is indistinguishable from any other
+// codes.Internal error to a client.
+type errorResponse struct {
+	Error   string `json:"error"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Recover converts a panic in h into a codes.Internal JSON response
+// instead of crashing the server or leaking a bare stack trace to the
+// client.
+func Recover(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				slog.Error("panic recovered",
+					"path", r.URL.Path,
+					"request_id", RequestIDFromContext(r.Context()),
+					"panic", rec,
+				)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(errorResponse{
+					Error:   "internal error",
+					Code:    13, // codes.Internal
+					Message: "internal error",
+				})
+			}
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RedirectHTTP redirects any request whose X-Forwarded-Proto header is
+// "http" to the equivalent HTTPS URL, for use behind a TLS-terminating
+// load balancer.
+func RedirectHTTP(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Forwarded-Proto") == "http" {
+			// Use RequestURI since it is what the client set, unmodified.
+			// Other methods, such as URL.String(), reassemble the URL.
+			redirectTo := "https://" + r.Host + r.RequestURI
+			http.Redirect(w, r, redirectTo, http.StatusMovedPermanently)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,165 @@
+// Package wsproxy upgrades WebSocket requests into the chunked,
+// newline-delimited JSON streams that grpc-gateway produces for
+// server-streaming RPCs. Browsers cannot read a chunked HTTP/1.1
+// response incrementally from fetch(), so streaming endpoints are
+// otherwise unreachable without the gRPC-Web bridge; this lets them be
+// consumed over a plain WebSocket instead.
+//
+// Modeled on tmc/grpc-websocket-proxy, as used by etcd's embed/serve.go.
+package wsproxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// MethodPredicate reports whether r should be bridged over WebSocket
+// rather than passed through to the wrapped handler unchanged.
+type MethodPredicate func(r *http.Request) bool
+
+// Proxy wraps a grpc-gateway handler, upgrading requests that match its
+// predicate to WebSocket connections.
+type Proxy struct {
+	backend   http.Handler
+	predicate MethodPredicate
+	upgrader  websocket.Upgrader
+}
+
+// Option configures a Proxy.
+type Option func(*Proxy)
+
+// WithMethodPredicate restricts bridging to requests for which pred
+// returns true. The default predicate matches every request.
+func WithMethodPredicate(pred MethodPredicate) Option {
+	return func(p *Proxy) { p.predicate = pred }
+}
+
+// WithPathPrefix restricts bridging to requests whose path starts with
+// prefix, e.g. the streaming endpoints of the things service.
+func WithPathPrefix(prefix string) Option {
+	return WithMethodPredicate(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	})
+}
+
+// New wraps backend with a Proxy, applying opts.
+func New(backend http.Handler, opts ...Option) *Proxy {
+	p := &Proxy{
+		backend:   backend,
+		predicate: func(r *http.Request) bool { return true },
+		upgrader: websocket.Upgrader{
+			// Select "bearer" when offered, since browsers abort a
+			// handshake whose requested subprotocols none were accepted.
+			Subprotocols: []string{"bearer"},
+			CheckOrigin:  func(r *http.Request) bool { return true },
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// ServeHTTP passes non-WebSocket requests straight to the backend. A
+// WebSocket upgrade matching the configured predicate is instead bridged:
+// the backend's newline-delimited JSON stream is re-split on those
+// delimiters and forwarded as one WebSocket text message per JSON
+// object, and the client closing the socket cancels the backend's
+// request context.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsWebSocketUpgrade(r) || !p.predicate(r) {
+		p.backend.ServeHTTP(w, r)
+		return
+	}
+
+	conn, err := p.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	// A browser cannot set arbitrary headers on a WebSocket handshake, so
+	// accept a bearer token via the Sec-WebSocket-Protocol subprotocol or
+	// an "access_token" query parameter instead.
+	req := r.WithContext(ctx)
+	if token := bearerToken(r); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	// Any client-initiated close (including an abnormal closure) should
+	// cancel the in-flight backend request rather than leak it.
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	p.backend.ServeHTTP(newResponseWriter(conn), req)
+}
+
+// bearerToken extracts a bearer token from the Sec-WebSocket-Protocol
+// header - sent by browsers as new WebSocket(url, ["bearer", token]),
+// which arrives as "Sec-WebSocket-Protocol: bearer, <token>" - or from
+// an "access_token" query parameter.
+func bearerToken(r *http.Request) string {
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i, proto := range protocols {
+		if strings.EqualFold(strings.TrimSpace(proto), "bearer") && i+1 < len(protocols) {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+// responseWriter adapts an http.ResponseWriter interface onto a
+// WebSocket connection so grpc-gateway's streaming handler can write to
+// it without being aware WebSocket is involved. runtime.ServeMux writes
+// a marshaled JSON object and its delimiter (by default "\n") in
+// separate Write calls, so responseWriter buffers until it sees a
+// trailing newline and then sends exactly one text message per object.
+type responseWriter struct {
+	conn   *websocket.Conn
+	header http.Header
+	status int
+	buf    []byte
+}
+
+func newResponseWriter(conn *websocket.Conn) *responseWriter {
+	return &responseWriter{conn: conn, header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(status int) { w.status = status }
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		return len(p), nil
+	}
+
+	msg := bytes.TrimRight(w.buf, "\n")
+	w.buf = w.buf[:0]
+	if len(msg) == 0 {
+		return len(p), nil
+	}
+	if err := w.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush is a no-op; Write already sends a message as soon as a full
+// JSON object has been buffered.
+func (w *responseWriter) Flush() {}